@@ -0,0 +1,333 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// buildClientset resolves a Kubernetes client the same way kubectl does:
+// $KUBECONFIG, then ~/.kube/config if it exists, falling back to
+// in-cluster config when neither is present.
+func buildClientset() (*kubernetes.Clientset, error) {
+	kubeconfig := os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path := filepath.Join(home, ".kube", "config")
+			if _, err := os.Stat(path); err == nil {
+				kubeconfig = path
+			}
+		}
+	}
+
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// runApply generates the Kubernetes manifests for composeFile and creates or
+// updates them in namespace, analogous to `podman play kube`.
+func runApply(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	composeFileFlag := fs.String("compose-file", "docker-compose.yml", "Specify an alternate compose `file`")
+	namespace := fs.String("namespace", "default", "Namespace to apply the generated objects to")
+	dryRun := fs.String("dry-run", "", "Either 'client' (print only) or 'server' (server-side dry run)")
+	project := fs.String("project-name", "kube", "Project name used to label generated objects")
+	composeSpecFlag := fs.String("compose-spec", "", "Compose parser backend to use: auto, libcompose or compose-go")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	projectName = *project
+	composeSpec = *composeSpecFlag
+
+	serviceObjects, volumeObjects, err := generate(*composeFileFlag)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun == "client" {
+		for name, objects := range serviceObjects {
+			for _, obj := range objects {
+				fmt.Printf("dry-run: would apply %s for service %s in namespace %s\n", kindOf(obj), name, *namespace)
+			}
+		}
+		for _, obj := range volumeObjects {
+			fmt.Printf("dry-run: would apply %T in namespace %s\n", obj, *namespace)
+		}
+		return nil
+	}
+
+	clientset, err := buildClientset()
+	if err != nil {
+		return err
+	}
+
+	serverDryRun := *dryRun == "server"
+	for _, objects := range serviceObjects {
+		for _, obj := range objects {
+			if err := applyObject(clientset, *namespace, obj, serverDryRun); err != nil {
+				return err
+			}
+		}
+	}
+	for _, obj := range volumeObjects {
+		if err := applyObject(clientset, *namespace, obj, serverDryRun); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyObject creates obj in namespace, or updates it if it already
+// exists. serverDryRun passes the Kubernetes API's own dry-run handling
+// through to the call so nothing is actually persisted.
+func applyObject(clientset *kubernetes.Clientset, namespace string, obj interface{}, serverDryRun bool) error {
+	createOpts := metav1.CreateOptions{}
+	updateOpts := metav1.UpdateOptions{}
+	if serverDryRun {
+		createOpts.DryRun = []string{metav1.DryRunAll}
+		updateOpts.DryRun = []string{metav1.DryRunAll}
+	}
+	ctx := context.Background()
+
+	switch o := obj.(type) {
+	case *appsv1beta1.Deployment:
+		return createOrUpdate(o.Name,
+			func() error {
+				_, err := clientset.AppsV1beta1().Deployments(namespace).Create(ctx, o, createOpts)
+				return err
+			},
+			func() error {
+				_, err := clientset.AppsV1beta1().Deployments(namespace).Update(ctx, o, updateOpts)
+				return err
+			})
+	case *appsv1beta1.StatefulSet:
+		return createOrUpdate(o.Name,
+			func() error {
+				_, err := clientset.AppsV1beta1().StatefulSets(namespace).Create(ctx, o, createOpts)
+				return err
+			},
+			func() error {
+				_, err := clientset.AppsV1beta1().StatefulSets(namespace).Update(ctx, o, updateOpts)
+				return err
+			})
+	case *extensionsv1beta1.DaemonSet:
+		return createOrUpdate(o.Name,
+			func() error {
+				_, err := clientset.ExtensionsV1beta1().DaemonSets(namespace).Create(ctx, o, createOpts)
+				return err
+			},
+			func() error {
+				_, err := clientset.ExtensionsV1beta1().DaemonSets(namespace).Update(ctx, o, updateOpts)
+				return err
+			})
+	case *corev1.ReplicationController:
+		return createOrUpdate(o.Name,
+			func() error {
+				_, err := clientset.CoreV1().ReplicationControllers(namespace).Create(ctx, o, createOpts)
+				return err
+			},
+			func() error {
+				_, err := clientset.CoreV1().ReplicationControllers(namespace).Update(ctx, o, updateOpts)
+				return err
+			})
+	case *batchv1.Job:
+		return createOrUpdate(o.Name,
+			func() error { _, err := clientset.BatchV1().Jobs(namespace).Create(ctx, o, createOpts); return err },
+			func() error { _, err := clientset.BatchV1().Jobs(namespace).Update(ctx, o, updateOpts); return err })
+	case *corev1.Service:
+		return createOrUpdate(o.Name,
+			func() error { _, err := clientset.CoreV1().Services(namespace).Create(ctx, o, createOpts); return err },
+			func() error { _, err := clientset.CoreV1().Services(namespace).Update(ctx, o, updateOpts); return err })
+	case *corev1.PersistentVolumeClaim:
+		return createOrUpdate(o.Name,
+			func() error {
+				_, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, o, createOpts)
+				return err
+			},
+			func() error {
+				_, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Update(ctx, o, updateOpts)
+				return err
+			})
+	case *corev1.ConfigMap:
+		return createOrUpdate(o.Name,
+			func() error {
+				_, err := clientset.CoreV1().ConfigMaps(namespace).Create(ctx, o, createOpts)
+				return err
+			},
+			func() error {
+				_, err := clientset.CoreV1().ConfigMaps(namespace).Update(ctx, o, updateOpts)
+				return err
+			})
+	case *corev1.Secret:
+		return createOrUpdate(o.Name,
+			func() error { _, err := clientset.CoreV1().Secrets(namespace).Create(ctx, o, createOpts); return err },
+			func() error { _, err := clientset.CoreV1().Secrets(namespace).Update(ctx, o, updateOpts); return err })
+	default:
+		return fmt.Errorf("unsupported object type %T", obj)
+	}
+}
+
+// createOrUpdate calls create, falling back to update only when create
+// failed because the object already exists. Any other create error (RBAC
+// denial, invalid spec, network error, ...) is returned as-is instead of
+// being masked by whatever update() then returns.
+func createOrUpdate(name string, create, update func() error) error {
+	if err := create(); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create %s: %v", name, err)
+		}
+		if err := update(); err != nil {
+			return fmt.Errorf("failed to update %s: %v", name, err)
+		}
+	}
+	fmt.Println(name)
+	return nil
+}
+
+// runTeardown deletes every object labeled with project-name in namespace.
+func runTeardown(args []string) error {
+	fs := flag.NewFlagSet("teardown", flag.ExitOnError)
+	namespace := fs.String("namespace", "default", "Namespace to delete the project's objects from")
+	project := fs.String("project-name", "kube", "Project name used to select objects for deletion")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	clientset, err := buildClientset()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	selector := metav1.ListOptions{LabelSelector: fmt.Sprintf("project=%s", *project)}
+
+	deployments, err := clientset.AppsV1beta1().Deployments(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments.Items {
+		if err := clientset.AppsV1beta1().Deployments(*namespace).Delete(ctx, d.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(d.Name)
+	}
+
+	statefulSets, err := clientset.AppsV1beta1().StatefulSets(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, s := range statefulSets.Items {
+		if err := clientset.AppsV1beta1().StatefulSets(*namespace).Delete(ctx, s.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(s.Name)
+	}
+
+	daemonSets, err := clientset.ExtensionsV1beta1().DaemonSets(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, d := range daemonSets.Items {
+		if err := clientset.ExtensionsV1beta1().DaemonSets(*namespace).Delete(ctx, d.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(d.Name)
+	}
+
+	rcs, err := clientset.CoreV1().ReplicationControllers(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, rc := range rcs.Items {
+		if err := clientset.CoreV1().ReplicationControllers(*namespace).Delete(ctx, rc.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(rc.Name)
+	}
+
+	jobs, err := clientset.BatchV1().Jobs(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, j := range jobs.Items {
+		if err := clientset.BatchV1().Jobs(*namespace).Delete(ctx, j.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(j.Name)
+	}
+
+	services, err := clientset.CoreV1().Services(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, s := range services.Items {
+		if err := clientset.CoreV1().Services(*namespace).Delete(ctx, s.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(s.Name)
+	}
+
+	configMaps, err := clientset.CoreV1().ConfigMaps(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, c := range configMaps.Items {
+		if err := clientset.CoreV1().ConfigMaps(*namespace).Delete(ctx, c.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(c.Name)
+	}
+
+	secrets, err := clientset.CoreV1().Secrets(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, s := range secrets.Items {
+		if err := clientset.CoreV1().Secrets(*namespace).Delete(ctx, s.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(s.Name)
+	}
+
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(*namespace).List(ctx, selector)
+	if err != nil {
+		return err
+	}
+	for _, p := range pvcs.Items {
+		if err := clientset.CoreV1().PersistentVolumeClaims(*namespace).Delete(ctx, p.Name, metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		fmt.Println(p.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/libcompose/config"
+	"github.com/docker/libcompose/project"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// healthCheckFromLibcompose adapts libcompose's own healthcheck type to our
+// neutral healthCheck. libcompose has no notion of start_period (a v3-only
+// field), so it's always left empty for this backend.
+func healthCheckFromLibcompose(hc *config.HealthConfig) *healthCheck {
+	if hc == nil {
+		return nil
+	}
+	return &healthCheck{
+		Test:     hc.Test,
+		Interval: hc.Interval,
+		Timeout:  hc.Timeout,
+		Retries:  hc.Retries,
+	}
+}
+
+// composeService is the neutral, parser-agnostic view of a compose service
+// that generate() translates into Kubernetes objects. Each composeBackend
+// is responsible for filling it in from whatever compose file version it
+// understands.
+type composeService struct {
+	Image          string
+	Command        []string
+	Environment    []string
+	Ports          []string
+	Volumes        []string
+	VolumesFrom    []string
+	CPUShares      int64
+	MemLimit       int64
+	CPUQuota       int64
+	MemReservation int64
+	Privileged     bool
+	Restart        string
+	HealthCheck    *healthCheck
+	DependsOn      []string
+	Deploy         deploySpec
+}
+
+// composeBackend parses a compose file into composeServices. libcompose only
+// understands the v1/v2 schema; compose-go understands v3's `deploy:` block.
+type composeBackend interface {
+	Parse(composeFile string) (map[string]*composeService, error)
+}
+
+// selectBackend picks a composeBackend. An explicit --compose-spec flag
+// wins; otherwise the compose file's own `version:` field decides, since
+// only 3.x documents carry a `deploy:` block worth a compose-go parse.
+func selectBackend(composeFile, override string) composeBackend {
+	switch override {
+	case "compose-go":
+		return composeGoBackend{}
+	case "libcompose":
+		return libcomposeBackend{}
+	}
+
+	if strings.HasPrefix(loadRawComposeFile(composeFile).Version, "3") {
+		return composeGoBackend{}
+	}
+	return libcomposeBackend{}
+}
+
+// libcomposeBackend wraps the original docker/libcompose v1/v2 parser.
+type libcomposeBackend struct{}
+
+func (libcomposeBackend) Parse(composeFile string) (map[string]*composeService, error) {
+	p := project.NewProject(&project.Context{
+		ProjectName:  projectName,
+		ComposeFiles: []string{composeFile},
+	})
+
+	if err := p.Parse(); err != nil {
+		return nil, fmt.Errorf("failed to parse the compose project from %s: %v", composeFile, err)
+	}
+
+	services := map[string]*composeService{}
+	for name, svc := range p.Configs {
+		services[name] = &composeService{
+			Image:          svc.Image,
+			Command:        svc.Command.Slice(),
+			Environment:    svc.Environment.Slice(),
+			Ports:          svc.Ports,
+			Volumes:        svc.Volumes.Slice(),
+			VolumesFrom:    svc.VolumesFrom,
+			CPUShares:      svc.CPUShares,
+			MemLimit:       svc.MemLimit,
+			CPUQuota:       svc.CPUQuota,
+			MemReservation: svc.MemReservation,
+			Privileged:     svc.Privileged,
+			Restart:        svc.Restart,
+			HealthCheck:    healthCheckFromLibcompose(svc.HealthCheck),
+			DependsOn:      svc.DependsOn,
+			Deploy:         defaultDeploySpec,
+		}
+	}
+	return services, nil
+}
+
+// rollingUpdateFromParallelism approximates a compose `update_config` as a
+// Deployment RollingUpdate. Swarm's "parallelism" is how many replicas are
+// taken down and replaced at once, which is MaxUnavailable, not MaxSurge
+// (extra *new* pods on top of the existing count).
+func rollingUpdateFromParallelism(parallelism int32) *appsv1beta1.RollingUpdateDeployment {
+	if parallelism <= 0 {
+		return nil
+	}
+	maxUnavailable := intstr.FromInt(int(parallelism))
+	return &appsv1beta1.RollingUpdateDeployment{MaxUnavailable: &maxUnavailable}
+}
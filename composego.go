@@ -0,0 +1,236 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/compose-spec/compose-go/loader"
+	"github.com/compose-spec/compose-go/types"
+	api "k8s.io/api/core/v1"
+)
+
+// composeGoBackend parses compose v3.x files (including `deploy:`) with
+// compose-spec/compose-go, the library modern tooling (docker stack deploy,
+// compose CLI v2) uses in place of the abandoned libcompose.
+type composeGoBackend struct{}
+
+func (composeGoBackend) Parse(composeFile string) (map[string]*composeService, error) {
+	data, err := ioutil.ReadFile(composeFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", composeFile, err)
+	}
+
+	project, err := loader.Load(types.ConfigDetails{
+		WorkingDir: filepath.Dir(composeFile),
+		ConfigFiles: []types.ConfigFile{
+			{Filename: composeFile, Content: data},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the compose-spec project from %s: %v", composeFile, err)
+	}
+
+	services := map[string]*composeService{}
+	for _, svc := range project.Services {
+		cpuShares, memLimit, cpuQuota, memReservation := resourcesFromDeploy(svc.Deploy)
+		services[svc.Name] = &composeService{
+			Image:          svc.Image,
+			Command:        []string(svc.Command),
+			Environment:    envToSlice(svc.Environment),
+			Ports:          portsToSlice(svc.Ports),
+			Volumes:        volumesToSlice(svc.Volumes),
+			VolumesFrom:    svc.VolumesFrom,
+			Privileged:     svc.Privileged,
+			Restart:        svc.Restart,
+			HealthCheck:    healthCheckFrom(svc.HealthCheck),
+			DependsOn:      dependsOnNames(svc.DependsOn),
+			Deploy:         deploySpecFrom(svc.Deploy),
+			CPUShares:      cpuShares,
+			MemLimit:       memLimit,
+			CPUQuota:       cpuQuota,
+			MemReservation: memReservation,
+		}
+	}
+	return services, nil
+}
+
+// resourcesFromDeploy translates `deploy.resources.limits`/`reservations`
+// into the same (cpuShares, memLimit, cpuQuota, memReservation) shape the
+// plain compose CPU/memory fields use, so generate() doesn't need to know
+// which backend produced them.
+func resourcesFromDeploy(deploy *types.DeployConfig) (cpuShares, memLimit, cpuQuota, memReservation int64) {
+	if deploy == nil {
+		return
+	}
+	if limits := deploy.Resources.Limits; limits != nil {
+		cpuShares = nanoCPUsToMilli(limits.NanoCPUs)
+		memLimit = int64(limits.MemoryBytes)
+	}
+	if reservations := deploy.Resources.Reservations; reservations != nil {
+		cpuQuota = nanoCPUsToMilli(reservations.NanoCPUs)
+		memReservation = int64(reservations.MemoryBytes)
+	}
+	return
+}
+
+// nanoCPUsToMilli converts compose-spec's decimal CPU string (e.g. "0.5")
+// into milliCPUs the way resource.NewMilliQuantity expects.
+func nanoCPUsToMilli(nanoCPUs string) int64 {
+	var cpus float64
+	if _, err := fmt.Sscanf(nanoCPUs, "%f", &cpus); err != nil {
+		return 0
+	}
+	return int64(cpus * 1000)
+}
+
+func envToSlice(env types.MappingWithEquals) []string {
+	var out []string
+	for k, v := range env {
+		if v != nil {
+			out = append(out, fmt.Sprintf("%s=%s", k, *v))
+		}
+	}
+	return out
+}
+
+func portsToSlice(ports []types.ServicePortConfig) []string {
+	var out []string
+	for _, p := range ports {
+		port := fmt.Sprintf("%d/%s", p.Target, p.Protocol)
+		if p.Published != "" {
+			port = fmt.Sprintf("%s:%d/%s", p.Published, p.Target, p.Protocol)
+		}
+		out = append(out, port)
+	}
+	return out
+}
+
+func volumesToSlice(volumes []types.ServiceVolumeConfig) []string {
+	var out []string
+	for _, v := range volumes {
+		if v.Source == "" {
+			out = append(out, v.Target)
+			continue
+		}
+		entry := fmt.Sprintf("%s:%s", v.Source, v.Target)
+		if v.ReadOnly {
+			entry += ":ro"
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func dependsOnNames(dependsOn types.DependsOnConfig) []string {
+	var out []string
+	for name := range dependsOn {
+		out = append(out, name)
+	}
+	return out
+}
+
+func healthCheckFrom(hc *types.HealthCheckConfig) *healthCheck {
+	if hc == nil || hc.Disable {
+		return nil
+	}
+	health := &healthCheck{Test: hc.Test}
+	if hc.Interval != nil {
+		health.Interval = hc.Interval.String()
+	}
+	if hc.Timeout != nil {
+		health.Timeout = hc.Timeout.String()
+	}
+	if hc.Retries != nil {
+		health.Retries = int(*hc.Retries)
+	}
+	if hc.StartPeriod != nil {
+		health.StartPeriod = hc.StartPeriod.String()
+	}
+	return health
+}
+
+// deploySpecFrom translates a compose v3 `deploy:` block into our internal
+// deploySpec, covering replicas, global mode, node placement constraints
+// and rolling update parallelism. Resource limits/reservations are
+// translated separately by resourcesFromDeploy.
+func deploySpecFrom(deploy *types.DeployConfig) deploySpec {
+	if deploy == nil {
+		return defaultDeploySpec
+	}
+
+	spec := deploySpec{Replicas: 1, Global: deploy.Mode == "global"}
+	if deploy.Replicas != nil {
+		spec.Replicas = int32(*deploy.Replicas)
+	}
+	if deploy.UpdateConfig != nil && deploy.UpdateConfig.Parallelism != nil {
+		spec.RollingUpdate = rollingUpdateFromParallelism(int32(*deploy.UpdateConfig.Parallelism))
+	}
+	spec.NodeSelector, spec.NodeAntiAffinity = nodeSelectorFromConstraints(deploy.Placement.Constraints)
+	return spec
+}
+
+// nodeSelectorFromConstraints maps compose-spec's simple
+// `node.labels.<key>==<value>` placement constraints onto a Kubernetes
+// NodeSelector, and `node.labels.<key>!=<value>` onto a NodeAffinity "NotIn"
+// requirement, since a plain NodeSelector has no way to express negation.
+// Anything else is not representable on Kubernetes and is dropped with a
+// warning rather than silently ignored.
+func nodeSelectorFromConstraints(constraints []string) (map[string]string, []api.NodeSelectorRequirement) {
+	selector := map[string]string{}
+	var notIn []api.NodeSelectorRequirement
+	for _, c := range constraints {
+		key, value, op, ok := splitConstraint(c)
+		if !ok {
+			log.Printf("warning: unsupported placement constraint %q ignored", c)
+			continue
+		}
+		const prefix = "node.labels."
+		if len(key) <= len(prefix) || key[:len(prefix)] != prefix {
+			log.Printf("warning: unsupported placement constraint %q ignored", c)
+			continue
+		}
+		key = key[len(prefix):]
+		switch op {
+		case "==":
+			selector[key] = value
+		case "!=":
+			notIn = append(notIn, api.NodeSelectorRequirement{
+				Key:      key,
+				Operator: api.NodeSelectorOpNotIn,
+				Values:   []string{value},
+			})
+		}
+	}
+	if len(selector) == 0 {
+		selector = nil
+	}
+	return selector, notIn
+}
+
+// splitConstraint splits a placement constraint of the form "key==value" or
+// "key!=value" into its key, value and operator.
+func splitConstraint(c string) (key, value, op string, ok bool) {
+	if i := strings.Index(c, "!="); i != -1 {
+		return strings.TrimSpace(c[:i]), strings.TrimSpace(c[i+2:]), "!=", true
+	}
+	if i := strings.Index(c, "=="); i != -1 {
+		return strings.TrimSpace(c[:i]), strings.TrimSpace(c[i+2:]), "==", true
+	}
+	return "", "", "", false
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	batchv1 "k8s.io/api/batch/v1"
+	api "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// portMapping is a parsed Docker compose port entry of the form
+// "[host:]container[/proto]".
+type portMapping struct {
+	HostPort      int32
+	ContainerPort int32
+	Protocol      api.Protocol
+	Published     bool
+}
+
+// parsePortMapping parses a compose port string such as "8080:80/udp",
+// "80" or "53/udp" into its host port, container port and protocol.
+func parsePortMapping(port string) (portMapping, error) {
+	protocol := api.ProtocolTCP
+	if idx := strings.LastIndex(port, "/"); idx != -1 {
+		switch strings.ToLower(port[idx+1:]) {
+		case "udp":
+			protocol = api.ProtocolUDP
+		case "tcp", "":
+			protocol = api.ProtocolTCP
+		default:
+			return portMapping{}, fmt.Errorf("unknown protocol %q in port %q", port[idx+1:], port)
+		}
+		port = port[:idx]
+	}
+
+	var hostPort, containerPort int64
+	var published bool
+	var err error
+	if strings.Contains(port, ":") {
+		parts := strings.SplitN(port, ":", 2)
+		hostPort, err = strconv.ParseInt(parts[0], 10, 32)
+		if err != nil {
+			return portMapping{}, fmt.Errorf("invalid host port %q: %v", parts[0], err)
+		}
+		containerPort, err = strconv.ParseInt(parts[1], 10, 32)
+		if err != nil {
+			return portMapping{}, fmt.Errorf("invalid container port %q: %v", parts[1], err)
+		}
+		published = true
+	} else {
+		containerPort, err = strconv.ParseInt(port, 10, 32)
+		if err != nil {
+			return portMapping{}, fmt.Errorf("invalid container port %q: %v", port, err)
+		}
+	}
+
+	return portMapping{
+		HostPort:      int32(hostPort),
+		ContainerPort: int32(containerPort),
+		Protocol:      protocol,
+		Published:     published,
+	}, nil
+}
+
+// deploySpec carries the knobs that a compose v3 `deploy:` block can set on
+// a workload, on top of what the plain compose service fields give us.
+type deploySpec struct {
+	Replicas      int32
+	RollingUpdate *appsv1beta1.RollingUpdateDeployment
+	Global        bool
+	NodeSelector  map[string]string
+	// NodeAntiAffinity holds placement constraints that NodeSelector can't
+	// express, e.g. negated ("!=") constraints, translated into the
+	// pod's NodeAffinity instead.
+	NodeAntiAffinity []api.NodeSelectorRequirement
+}
+
+// defaultDeploySpec is used for services with no `deploy:` block.
+var defaultDeploySpec = deploySpec{Replicas: 1}
+
+func replicationController(name string, pod *api.PodSpec, spec deploySpec) *api.ReplicationController {
+	replicas := spec.Replicas
+	return &api.ReplicationController{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ReplicationController",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   strings.ToLower(name),
+			Labels: map[string]string{"project": projectName},
+		},
+		Spec: api.ReplicationControllerSpec{
+			Replicas: &replicas,
+			Template: &api.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"service": name},
+				},
+				Spec: *pod,
+			},
+		},
+	}
+}
+
+func deployment(name string, pod *api.PodSpec, spec deploySpec) *appsv1beta1.Deployment {
+	replicas := spec.Replicas
+	labels := map[string]string{"service": name}
+	strategy := appsv1beta1.DeploymentStrategy{}
+	if spec.RollingUpdate != nil {
+		strategy.Type = appsv1beta1.RollingUpdateDeploymentStrategyType
+		strategy.RollingUpdate = spec.RollingUpdate
+	}
+	return &appsv1beta1.Deployment{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Deployment",
+			APIVersion: "apps/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   strings.ToLower(name),
+			Labels: map[string]string{"project": projectName},
+		},
+		Spec: appsv1beta1.DeploymentSpec{
+			Replicas: &replicas,
+			Strategy: strategy,
+			Template: api.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: *pod,
+			},
+		},
+	}
+}
+
+func statefulSet(name string, pod *api.PodSpec, spec deploySpec) *appsv1beta1.StatefulSet {
+	replicas := spec.Replicas
+	labels := map[string]string{"service": name}
+	return &appsv1beta1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   strings.ToLower(name),
+			Labels: map[string]string{"project": projectName},
+		},
+		Spec: appsv1beta1.StatefulSetSpec{
+			ServiceName: strings.ToLower(name),
+			Replicas:    &replicas,
+			Template: api.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: *pod,
+			},
+		},
+	}
+}
+
+// daemonSet is generated for services whose compose `deploy.mode` is
+// "global", one pod per matching node instead of a replica count.
+func daemonSet(name string, pod *api.PodSpec) *extensionsv1beta1.DaemonSet {
+	labels := map[string]string{"service": name}
+	return &extensionsv1beta1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "extensions/v1beta1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   strings.ToLower(name),
+			Labels: map[string]string{"project": projectName},
+		},
+		Spec: extensionsv1beta1.DaemonSetSpec{
+			Template: api.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: *pod,
+			},
+		},
+	}
+}
+
+// podSpecOf returns the embedded PodSpec and, where one exists, the
+// replica count of a generated workload object. It lets callers that only
+// care about the container template (e.g. the Helm chart writer) work
+// across every workload kind generate() can produce.
+func podSpecOf(obj interface{}) (*api.PodSpec, *int32) {
+	switch o := obj.(type) {
+	case *appsv1beta1.Deployment:
+		return &o.Spec.Template.Spec, o.Spec.Replicas
+	case *api.ReplicationController:
+		return &o.Spec.Template.Spec, o.Spec.Replicas
+	case *appsv1beta1.StatefulSet:
+		return &o.Spec.Template.Spec, o.Spec.Replicas
+	case *extensionsv1beta1.DaemonSet:
+		return &o.Spec.Template.Spec, nil
+	case *batchv1.Job:
+		return &o.Spec.Template.Spec, nil
+	default:
+		return nil, nil
+	}
+}
+
+// kindOf returns the lower-case file-name fragment used for a generated
+// workload object, e.g. "deployment", "rc", "job" or "pod".
+func kindOf(obj interface{}) string {
+	switch o := obj.(type) {
+	case *appsv1beta1.Deployment:
+		return "deployment"
+	case *api.ReplicationController:
+		return "rc"
+	case *appsv1beta1.StatefulSet:
+		return "statefulset"
+	case *extensionsv1beta1.DaemonSet:
+		return "daemonset"
+	case *batchv1.Job:
+		if o.Spec.Template.Spec.RestartPolicy == api.RestartPolicyNever {
+			return "pod"
+		}
+		return "job"
+	default:
+		return "pod"
+	}
+}
+
+// minNodePort and maxNodePort bound the default range
+// `--service-node-port-range` allows, the only range a NodePort.NodePort
+// value is guaranteed to be valid in.
+const (
+	minNodePort = 30000
+	maxNodePort = 32767
+)
+
+// service builds a v1/Service for the given ports. It is NodePort when any
+// of the ports carries a host-side mapping, ClusterIP otherwise. A service
+// with no ports at all (generated solely so another service's depends_on
+// can resolve it by name) is headless, since a ClusterIP Service requires
+// at least one port.
+func service(name string, ports []portMapping) *api.Service {
+	serviceType := api.ServiceTypeClusterIP
+	var servicePorts []api.ServicePort
+	for i, port := range ports {
+		servicePort := api.ServicePort{
+			Name:       fmt.Sprintf("port-%d", i),
+			Port:       port.ContainerPort,
+			TargetPort: intstr.FromInt(int(port.ContainerPort)),
+			Protocol:   port.Protocol,
+		}
+		if port.Published {
+			serviceType = api.ServiceTypeNodePort
+			switch {
+			case port.HostPort >= minNodePort && port.HostPort <= maxNodePort:
+				servicePort.NodePort = port.HostPort
+			default:
+				log.Printf("warning: host port %d for service %s is outside the NodePort range %d-%d; Kubernetes will assign one instead",
+					port.HostPort, name, minNodePort, maxNodePort)
+			}
+		}
+		servicePorts = append(servicePorts, servicePort)
+	}
+
+	spec := api.ServiceSpec{
+		Type:     serviceType,
+		Selector: map[string]string{"service": name},
+		Ports:    servicePorts,
+	}
+	if len(servicePorts) == 0 {
+		spec.ClusterIP = api.ClusterIPNone
+	}
+
+	return &api.Service{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   strings.ToLower(name),
+			Labels: map[string]string{"project": projectName},
+		},
+		Spec: spec,
+	}
+}
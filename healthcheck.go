@@ -0,0 +1,125 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// healthCheck is the neutral, parser-agnostic view of a compose
+// `healthcheck` block, analogous to composeService for the service as a
+// whole. It exists so generate() doesn't depend on either backend's own
+// healthcheck type, both of which model the fields slightly differently.
+type healthCheck struct {
+	Test        []string
+	Interval    string
+	Timeout     string
+	Retries     int
+	StartPeriod string
+}
+
+// probeFromHealthCheck translates a compose `healthcheck` into a Probe. It
+// returns nil when hc is nil, empty, or explicitly disabled ("NONE").
+func probeFromHealthCheck(hc *healthCheck) *api.Probe {
+	if hc == nil || len(hc.Test) == 0 {
+		return nil
+	}
+
+	test := hc.Test
+	if test[0] == "NONE" {
+		return nil
+	}
+
+	probe := &api.Probe{
+		TimeoutSeconds:      parseSeconds(hc.Timeout),
+		PeriodSeconds:       parseSeconds(hc.Interval),
+		InitialDelaySeconds: parseSeconds(hc.StartPeriod),
+		FailureThreshold:    int32(hc.Retries),
+	}
+
+	cmd := test
+	switch {
+	case len(test) > 0 && test[0] == "CMD-SHELL":
+		// Unlike CMD, which is already split into argv, CMD-SHELL's
+		// remainder is a single shell command string and needs a shell
+		// to interpret it, exactly like Docker's own healthcheck does.
+		cmd = append([]string{"sh", "-c"}, test[1:]...)
+	case len(test) > 1 && test[0] == "CMD":
+		cmd = test[1:]
+	}
+
+	// A single command that looks like a URL maps to HTTPGet/TCPSocket,
+	// the same way `podman healthcheck` and kompose detect it.
+	if len(cmd) == 1 {
+		if u, err := url.Parse(cmd[0]); err == nil && u.Scheme != "" && u.Host != "" {
+			port := portFromURL(u)
+			switch u.Scheme {
+			case "http", "https":
+				probe.HTTPGet = &api.HTTPGetAction{Path: u.Path, Port: intstr.FromInt(port)}
+				return probe
+			case "tcp":
+				probe.TCPSocket = &api.TCPSocketAction{Port: intstr.FromInt(port)}
+				return probe
+			}
+		}
+	}
+
+	probe.Exec = &api.ExecAction{Command: cmd}
+	return probe
+}
+
+func portFromURL(u *url.URL) int {
+	if p := u.Port(); p != "" {
+		if n, err := strconv.Atoi(p); err == nil {
+			return n
+		}
+	}
+	if u.Scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+// parseSeconds parses a compose duration string such as "30s" or "1m30s"
+// into whole seconds, defaulting to 0 (the Kubernetes probe default) when
+// it can't be parsed.
+func parseSeconds(d string) int32 {
+	if d == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(d)
+	if err != nil {
+		return 0
+	}
+	return int32(duration.Seconds())
+}
+
+// waitForContainer builds an init container that blocks until dependency's
+// Service DNS name resolves, the same role `depends_on` plays in compose.
+func waitForContainer(dependency string) api.Container {
+	return api.Container{
+		Name:  "wait-for-" + strings.ToLower(dependency),
+		Image: "busybox:1.31",
+		Command: []string{
+			"sh", "-c",
+			"until nslookup " + strings.ToLower(dependency) + "; do echo waiting for " + dependency + "; sleep 2; done",
+		},
+	}
+}
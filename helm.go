@@ -0,0 +1,198 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	api "k8s.io/api/core/v1"
+)
+
+// chartMetadata is Chart.yaml, the minimum a Helm v3 chart needs.
+type chartMetadata struct {
+	APIVersion  string `json:"apiVersion"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"appVersion"`
+}
+
+// writeHelmChart renders serviceObjects/volumeObjects as a Helm chart under
+// outputDir: Chart.yaml, values.yaml and templates/*.yaml. The parameters
+// users most commonly tune per environment - image, replica count,
+// resource limits and env vars - are extracted into values.yaml. Image,
+// replica count and env vars are referenced from the templates as
+// {{ .Values.<service>.* }}; resource limits are not, and the templates
+// keep the literal limits.
+func writeHelmChart(serviceObjects map[string][]interface{}, volumeObjects []interface{}) error {
+	templatesDir := filepath.Join(outputDir, "templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", templatesDir, err)
+	}
+
+	chart := chartMetadata{
+		APIVersion:  "v2",
+		Name:        projectName,
+		Description: fmt.Sprintf("A Helm chart generated by compose2kube from %s", composeFile),
+		Version:     "0.1.0",
+		AppVersion:  "1.0",
+	}
+	chartData, err := yaml.Marshal(chart)
+	if err != nil {
+		return fmt.Errorf("failed to marshal Chart.yaml: %v", err)
+	}
+	chartPath := filepath.Join(outputDir, "Chart.yaml")
+	if err := ioutil.WriteFile(chartPath, chartData, 0644); err != nil {
+		return fmt.Errorf("failed to write Chart.yaml: %v", err)
+	}
+	fmt.Println(chartPath)
+
+	var names []string
+	for name := range serviceObjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := map[string]interface{}{}
+	for _, name := range names {
+		objects := serviceObjects[name]
+		key := strings.ToLower(name)
+		if pod, replicas := podSpecOf(objects[0]); pod != nil {
+			values[key] = helmValues(pod, replicas)
+		}
+
+		var docs [][]byte
+		for _, obj := range objects {
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				return fmt.Errorf("failed to marshal %s: %v", name, err)
+			}
+			docs = append(docs, templatizeWorkload(data, key))
+		}
+
+		outputFileName := fmt.Sprintf("%s-%s.yaml", name, kindOf(objects[0]))
+		outputFilePath := filepath.Join(templatesDir, outputFileName)
+		data := []byte(strings.Join(bytesToStrings(docs), "---\n"))
+		if err := ioutil.WriteFile(outputFilePath, data, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", outputFileName, err)
+		}
+		fmt.Println(outputFilePath)
+	}
+
+	for _, obj := range volumeObjects {
+		if _, err := writeObjectTo(templatesDir, obj); err != nil {
+			return fmt.Errorf("failed to write volume object: %v", err)
+		}
+	}
+
+	valuesData, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to marshal values.yaml: %v", err)
+	}
+	valuesPath := filepath.Join(outputDir, "values.yaml")
+	if err := ioutil.WriteFile(valuesPath, valuesData, 0644); err != nil {
+		return fmt.Errorf("failed to write values.yaml: %v", err)
+	}
+	fmt.Println(valuesPath)
+
+	return nil
+}
+
+// helmValues extracts the knobs of a workload's pod template that are
+// worth overriding per environment.
+func helmValues(pod *api.PodSpec, replicas *int32) map[string]interface{} {
+	v := map[string]interface{}{}
+	container := pod.Containers[0]
+
+	v["image"] = container.Image
+	if replicas != nil {
+		v["replicaCount"] = *replicas
+	}
+
+	if limits := container.Resources.Limits; len(limits) > 0 {
+		resources := map[string]string{}
+		if cpu, ok := limits[api.ResourceCPU]; ok {
+			resources["cpu"] = cpu.String()
+		}
+		if mem, ok := limits[api.ResourceMemory]; ok {
+			resources["memory"] = mem.String()
+		}
+		v["resources"] = resources
+	}
+
+	if len(container.Env) > 0 {
+		env := map[string]string{}
+		for _, e := range container.Env {
+			env[e.Name] = e.Value
+		}
+		v["env"] = env
+	}
+
+	return v
+}
+
+// templatizeWorkload replaces the literal image, replica count and env var
+// values in a marshaled workload document with Helm template placeholders
+// pointing at the values extracted into values.yaml by helmValues.
+func templatizeWorkload(doc []byte, key string) []byte {
+	// Only the main container's image is parameterized; the "waiting for
+	// a dependency" init containers added by depends_on keep their fixed
+	// busybox image (see waitForContainer in healthcheck.go), and the
+	// main container's "containers:" block always marshals before
+	// "initContainers:" since ghodss/yaml sorts fields alphabetically.
+	doc = templatizeFirstScalar(doc, "image", fmt.Sprintf("{{ .Values.%s.image }}", key))
+	doc = templatizeScalar(doc, "replicas", fmt.Sprintf("{{ .Values.%s.replicaCount }}", key))
+	doc = templatizeEnv(doc, key)
+	return doc
+}
+
+// templatizeScalar replaces every "field: value" line (including a list
+// item's first "- field: value" line) with "field: placeholder",
+// preserving indentation.
+func templatizeScalar(doc []byte, field, placeholder string) []byte {
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)^(\s*(?:- )?%s:) .+$`, regexp.QuoteMeta(field)))
+	return re.ReplaceAll(doc, []byte(fmt.Sprintf("${1} %s", placeholder)))
+}
+
+// templatizeFirstScalar is templatizeScalar restricted to the first match.
+func templatizeFirstScalar(doc []byte, field, placeholder string) []byte {
+	re := regexp.MustCompile(fmt.Sprintf(`(?m)^(\s*(?:- )?%s:) .+$`, regexp.QuoteMeta(field)))
+	loc := re.FindIndex(doc)
+	if loc == nil {
+		return doc
+	}
+	replaced := re.ReplaceAll(doc[loc[0]:loc[1]], []byte(fmt.Sprintf("${1} %s", placeholder)))
+	out := append([]byte{}, doc[:loc[0]]...)
+	out = append(out, replaced...)
+	out = append(out, doc[loc[1]:]...)
+	return out
+}
+
+// templatizeEnv replaces each "value: ..." line of a container's env list
+// with a placeholder reading from values.yaml's per-service env map, keyed
+// by the immediately preceding "name: ..." line.
+func templatizeEnv(doc []byte, key string) []byte {
+	re := regexp.MustCompile(`(?m)^(\s*- name: (\S+)\n\s*value:) .+$`)
+	return re.ReplaceAllFunc(doc, func(match []byte) []byte {
+		groups := re.FindSubmatch(match)
+		return []byte(fmt.Sprintf("%s {{ .Values.%s.env.%s }}", groups[1], key, groups[2]))
+	})
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTemplatizeScalar(t *testing.T) {
+	doc := []byte("spec:\n  replicas: 3\n  template:\n    replicas: 1\n")
+	out := templatizeScalar(doc, "replicas", "{{ .Values.web.replicaCount }}")
+	want := "spec:\n  replicas: {{ .Values.web.replicaCount }}\n  template:\n    replicas: {{ .Values.web.replicaCount }}\n"
+	if string(out) != want {
+		t.Errorf("templatizeScalar() = %q, want %q", out, want)
+	}
+}
+
+func TestTemplatizeFirstScalar(t *testing.T) {
+	doc := []byte("containers:\n- image: web:1.0\ninitContainers:\n- image: busybox\n")
+	out := templatizeFirstScalar(doc, "image", "{{ .Values.web.image }}")
+	want := "containers:\n- image: {{ .Values.web.image }}\ninitContainers:\n- image: busybox\n"
+	if string(out) != want {
+		t.Errorf("templatizeFirstScalar() = %q, want %q", out, want)
+	}
+}
+
+func TestTemplatizeFirstScalarNoMatch(t *testing.T) {
+	doc := []byte("containers:\n- name: web\n")
+	out := templatizeFirstScalar(doc, "image", "{{ .Values.web.image }}")
+	if string(out) != string(doc) {
+		t.Errorf("templatizeFirstScalar() on no match = %q, want unchanged %q", out, doc)
+	}
+}
+
+func TestTemplatizeEnv(t *testing.T) {
+	doc := []byte("env:\n- name: DB_HOST\n  value: localhost\n- name: DB_PORT\n  value: \"5432\"\n")
+	out := templatizeEnv(doc, "web")
+	want := "env:\n- name: DB_HOST\n  value: {{ .Values.web.env.DB_HOST }}\n- name: DB_PORT\n  value: {{ .Values.web.env.DB_PORT }}\n"
+	if string(out) != want {
+		t.Errorf("templatizeEnv() = %q, want %q", out, want)
+	}
+}
+
+func TestTemplatizeWorkload(t *testing.T) {
+	doc := []byte("spec:\n  replicas: 2\n  template:\n    spec:\n      containers:\n      - image: web:1.0\n        env:\n        - name: FOO\n          value: bar\n")
+	out := templatizeWorkload(doc, "web")
+	for _, want := range []string{
+		"{{ .Values.web.replicaCount }}",
+		"{{ .Values.web.image }}",
+		"{{ .Values.web.env.FOO }}",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("templatizeWorkload() missing %q in output:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ghodss/yaml"
+)
+
+// kustomization is kustomization.yaml, listing the resources a base or
+// overlay is built from.
+type kustomization struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Resources  []string `json:"resources"`
+}
+
+// devOverlay is the single scaffolded overlay environment. Users are
+// expected to copy it per real environment (staging, prod, ...) and add
+// their own patches.
+const devOverlay = "dev"
+
+// writeKustomize renders serviceObjects/volumeObjects as raw manifests under
+// outputDir/base, with a kustomization.yaml enumerating them, plus an
+// outputDir/overlays/<env> scaffold that references the base for users to
+// patch per environment.
+func writeKustomize(serviceObjects map[string][]interface{}, volumeObjects []interface{}) error {
+	baseDir := filepath.Join(outputDir, "base")
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", baseDir, err)
+	}
+
+	var names []string
+	for name := range serviceObjects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var resources []string
+	for _, name := range names {
+		outputFilePath, err := writeWorkloadTo(baseDir, name, serviceObjects[name])
+		if err != nil {
+			return err
+		}
+		resources = append(resources, filepath.Base(outputFilePath))
+		fmt.Println(outputFilePath)
+	}
+
+	for _, obj := range volumeObjects {
+		fileName, err := writeObjectTo(baseDir, obj)
+		if err != nil {
+			return fmt.Errorf("failed to write volume object: %v", err)
+		}
+		resources = append(resources, fileName)
+	}
+
+	if err := writeKustomization(baseDir, resources); err != nil {
+		return err
+	}
+
+	return writeKustomizeOverlay(devOverlay)
+}
+
+// writeKustomizeOverlay scaffolds outputDir/overlays/<env>, a
+// kustomization.yaml that resources in the base and is otherwise left for
+// the user to add patches to.
+func writeKustomizeOverlay(env string) error {
+	overlayDir := filepath.Join(outputDir, "overlays", env)
+	if err := os.MkdirAll(overlayDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", overlayDir, err)
+	}
+	return writeKustomization(overlayDir, []string{filepath.Join("..", "..", "base")})
+}
+
+func writeKustomization(dir string, resources []string) error {
+	data, err := yaml.Marshal(kustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Resources:  resources,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal kustomization.yaml: %v", err)
+	}
+
+	outputFilePath := filepath.Join(dir, "kustomization.yaml")
+	if err := ioutil.WriteFile(outputFilePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", outputFilePath, err)
+	}
+	fmt.Println(outputFilePath)
+	return nil
+}
@@ -24,18 +24,21 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/docker/libcompose/project"
-	"k8s.io/kubernetes/pkg/api/resource"
-	"k8s.io/kubernetes/pkg/api/unversioned"
-	api "k8s.io/kubernetes/pkg/api/v1"
-	batchv1 "k8s.io/kubernetes/pkg/apis/batch/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var (
-	composeFile  string
-	outputDir    string
-	pullPolicy   string
-	nodeSelector string
+	composeFile    string
+	outputDir      string
+	pullPolicy     string
+	nodeSelector   string
+	controllerType string
+	projectName    string
+	composeSpec    string
+	outputFormat   string
 )
 
 func init() {
@@ -43,30 +46,163 @@ func init() {
 	flag.StringVar(&outputDir, "output-dir", "output", "Kubernetes configs output `directory`")
 	flag.StringVar(&pullPolicy, "pull-policy", "", "Image Pull policy")
 	flag.StringVar(&nodeSelector, "node-selector", "", "Node Selector in the format of 'key=value;key2=value2'")
+	flag.StringVar(&controllerType, "controller", "deployment", "Controller type to generate for always-restarting services: deployment, rc or statefulset")
+	flag.StringVar(&projectName, "project-name", "kube", "Project name used to label generated objects")
+	flag.StringVar(&composeSpec, "compose-spec", "", "Compose parser backend to use: auto, libcompose or compose-go")
+	flag.StringVar(&outputFormat, "output-format", "yaml", "Output format to generate: yaml, helm or kustomize")
 }
 
+// main dispatches to the generate (default), apply or teardown subcommand.
+// Plain flag invocations with no subcommand keep behaving like the
+// original compose2kube, generating YAML on disk.
 func main() {
-	flag.Parse()
-
-	p := project.NewProject(&project.Context{
-		ProjectName:  "kube",
-		ComposeFiles: []string{composeFile},
-	})
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "apply":
+		if err := runApply(os.Args[2:]); err != nil {
+			log.Fatalf("%v", err)
+		}
+	case len(os.Args) > 1 && os.Args[1] == "teardown":
+		if err := runTeardown(os.Args[2:]); err != nil {
+			log.Fatalf("%v", err)
+		}
+	default:
+		args := os.Args[1:]
+		if len(args) > 0 && args[0] == "generate" {
+			args = args[1:]
+		}
+		if err := runGenerate(args); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+}
 
-	if err := p.Parse(); err != nil {
-		log.Fatalf("Failed to parse the compose project from %s: %v", composeFile, err)
+// runGenerate parses the compose file and writes the translated Kubernetes
+// manifests to outputDir in the requested outputFormat: a flat file per
+// object (yaml, the default), a Helm chart, or a Kustomize base+overlay.
+func runGenerate(args []string) error {
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return err
 	}
+
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		log.Fatalf("Failed to create the output directory %s: %v", outputDir, err)
+		return fmt.Errorf("failed to create the output directory %s: %v", outputDir, err)
+	}
+
+	serviceObjects, volumeObjects, err := generate(composeFile)
+	if err != nil {
+		return err
+	}
+
+	switch outputFormat {
+	case "", "yaml":
+		return writeYAML(serviceObjects, volumeObjects)
+	case "helm":
+		return writeHelmChart(serviceObjects, volumeObjects)
+	case "kustomize":
+		return writeKustomize(serviceObjects, volumeObjects)
+	default:
+		return fmt.Errorf("unknown output format %s", outputFormat)
+	}
+}
+
+// writeYAML writes one (multi-document) file per service plus one file per
+// shared volume/config/secret object directly into outputDir. This is the
+// original, flat compose2kube output.
+func writeYAML(serviceObjects map[string][]interface{}, volumeObjects []interface{}) error {
+	for name, objects := range serviceObjects {
+		outputFilePath, err := writeWorkloadTo(outputDir, name, objects)
+		if err != nil {
+			return err
+		}
+		fmt.Println(outputFilePath)
+	}
+
+	// Volumes, configs and secrets can be shared across services, so each
+	// gets written to its own file.
+	for _, obj := range volumeObjects {
+		if _, err := writeObjectTo(outputDir, obj); err != nil {
+			return fmt.Errorf("failed to write volume object: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// writeWorkloadTo marshals a service's objects (its workload plus an
+// optional Service) as a single "---"-separated document and writes it to
+// <dir>/<name>-<kind>.yaml.
+func writeWorkloadTo(dir, name string, objects []interface{}) (string, error) {
+	objType := kindOf(objects[0])
+
+	var docs [][]byte
+	for _, obj := range objects {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal: %v", err)
+		}
+		docs = append(docs, data)
+	}
+	data := []byte(strings.Join(bytesToStrings(docs), "---\n"))
+
+	outputFileName := fmt.Sprintf("%s-%s.yaml", name, objType)
+	outputFilePath := filepath.Join(dir, outputFileName)
+	if err := ioutil.WriteFile(outputFilePath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", outputFileName, err)
+	}
+	return outputFilePath, nil
+}
+
+// generate parses composeFileName and translates every service into its
+// Kubernetes workload (plus an optional Service), and returns any
+// PersistentVolumeClaim/ConfigMap/Secret objects those services reference.
+// It is shared by runGenerate (write to disk) and runApply (push to a
+// cluster).
+func generate(composeFileName string) (map[string][]interface{}, []interface{}, error) {
+	backend := selectBackend(composeFileName, composeSpec)
+	services, err := backend.Parse(composeFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw := loadRawComposeFile(composeFileName)
+	composeFileDir := filepath.Dir(composeFileName)
+
+	serviceObjects := map[string][]interface{}{}
+	var volumeObjects []interface{}
+	// seenVolumeObjects dedups PVCs/ConfigMaps/Secrets by kind and name
+	// across services, since a named volume shared via `volumes_from` (or
+	// just reused by name across services) would otherwise generate the
+	// same object once per service that references it.
+	seenVolumeObjects := map[string]bool{}
+	addVolumeObjects := func(objs ...interface{}) {
+		for _, obj := range objs {
+			key := fmt.Sprintf("%T/%s", obj, objectName(obj))
+			if seenVolumeObjects[key] {
+				continue
+			}
+			seenVolumeObjects[key] = true
+			volumeObjects = append(volumeObjects, obj)
+		}
+	}
+
+	// dependedOn records every service named in some other service's
+	// depends_on. The wait-for-<dependency> init container resolves its
+	// dependency by Service DNS name, so that dependency needs a Service
+	// even if it declares no ports of its own.
+	dependedOn := map[string]bool{}
+	for _, svc := range services {
+		for _, dep := range svc.DependsOn {
+			dependedOn[dep] = true
+		}
 	}
 
-	for name, service := range p.Configs {
+	for name, service := range services {
 		pod := &api.PodSpec{
 			Containers: []api.Container{
 				{
 					Name:  strings.ToLower(name),
 					Image: service.Image,
-					Args:  service.Command.Slice(),
+					Args:  service.Command,
 					Resources: api.ResourceRequirements{
 						Limits: api.ResourceList{},
 					},
@@ -82,6 +218,29 @@ func main() {
 			pod.Containers[0].Resources.Limits[api.ResourceMemory] = *resource.NewQuantity(service.MemLimit, "decimalSI")
 		}
 
+		// Reservations map to Requests, distinct from the Limits set above.
+		if service.CPUQuota != 0 || service.MemReservation != 0 {
+			pod.Containers[0].Resources.Requests = api.ResourceList{}
+			if service.CPUQuota != 0 {
+				pod.Containers[0].Resources.Requests[api.ResourceCPU] = *resource.NewMilliQuantity(service.CPUQuota, resource.BinarySI)
+			}
+			if service.MemReservation != 0 {
+				pod.Containers[0].Resources.Requests[api.ResourceMemory] = *resource.NewQuantity(service.MemReservation, "decimalSI")
+			}
+		}
+
+		// Translate the compose healthcheck into Liveness/Readiness probes.
+		if probe := probeFromHealthCheck(service.HealthCheck); probe != nil {
+			pod.Containers[0].LivenessProbe = probe
+			pod.Containers[0].ReadinessProbe = probe
+		}
+
+		// depends_on becomes an init container per dependency that blocks
+		// until the dependency's Service DNS name resolves.
+		for _, dep := range service.DependsOn {
+			pod.InitContainers = append(pod.InitContainers, waitForContainer(dep))
+		}
+
 		// If Privileged, create a SecurityContext and configure it
 		if service.Privileged == true {
 			priv := true
@@ -101,7 +260,7 @@ func main() {
 			case "Never":
 				pod.Containers[0].ImagePullPolicy = api.PullNever
 			default:
-				log.Fatalf("Unknown pull policy %s for service %s", pullPolicy, name)
+				return nil, nil, fmt.Errorf("unknown pull policy %s for service %s", pullPolicy, name)
 			}
 		}
 
@@ -115,104 +274,230 @@ func main() {
 			pod.NodeSelector = m
 		}
 
+		// deploy.placement.constraints adds to (but doesn't replace) any
+		// selector given via --node-selector.
+		for k, v := range service.Deploy.NodeSelector {
+			if pod.NodeSelector == nil {
+				pod.NodeSelector = map[string]string{}
+			}
+			pod.NodeSelector[k] = v
+		}
+
+		// Negated ("!=") placement constraints have no NodeSelector
+		// equivalent, so they become a required NodeAffinity instead.
+		if len(service.Deploy.NodeAntiAffinity) > 0 {
+			pod.Affinity = &api.Affinity{
+				NodeAffinity: &api.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &api.NodeSelector{
+						NodeSelectorTerms: []api.NodeSelectorTerm{
+							{MatchExpressions: service.Deploy.NodeAntiAffinity},
+						},
+					},
+				},
+			}
+		}
+
 		// Configure the environment variables
 		var environment []api.EnvVar
-		for _, envs := range service.Environment.Slice() {
+		for _, envs := range service.Environment {
 			value := strings.Split(envs, "=")
 			environment = append(environment, api.EnvVar{Name: value[0], Value: value[1]})
 		}
 
 		pod.Containers[0].Env = environment
 
-		// Configure the container ports.
+		// Configure the container ports, parsing the full
+		// "host:container/proto" form so host-mapped ports can be
+		// distinguished from container-only ports later on.
 		var ports []api.ContainerPort
+		var mappedPorts []portMapping
 		for _, port := range service.Ports {
-			// Check if we have to deal with a mapped port
-			if strings.Contains(port, ":") {
-				parts := strings.Split(port, ":")
-				port = parts[1]
-			}
-			portNumber, err := strconv.ParseInt(port, 10, 32)
+			mapping, err := parsePortMapping(port)
 			if err != nil {
-				log.Fatalf("Invalid container port %s for service %s", port, name)
+				return nil, nil, fmt.Errorf("%v for service %s", err, name)
 			}
-			ports = append(ports, api.ContainerPort{ContainerPort: int32(portNumber)})
+			mappedPorts = append(mappedPorts, mapping)
+			ports = append(ports, api.ContainerPort{ContainerPort: mapping.ContainerPort, Protocol: mapping.Protocol})
 		}
 
 		pod.Containers[0].Ports = ports
 
-		// Configure the container restart policy.
-		var (
-			objType string
-			data    []byte
-			err     error
-		)
-		switch service.Restart {
-		case "", "always":
-			objType = "rc"
+		// Configure volumes, bind mounts, configs and secrets.
+		kubeVolumes, mounts, pvcs := buildVolumes(service.Volumes)
+		addVolumeObjects(pvcs...)
+
+		// volumes_from shares another service's volumes with this one.
+		for _, depName := range service.VolumesFrom {
+			depService, ok := services[depName]
+			if !ok {
+				return nil, nil, fmt.Errorf("service %s has volumes_from %s, which does not exist", name, depName)
+			}
+			depVolumes, depMounts, depPVCs := buildVolumes(depService.Volumes)
+			kubeVolumes = append(kubeVolumes, depVolumes...)
+			mounts = append(mounts, depMounts...)
+			addVolumeObjects(depPVCs...)
+		}
+
+		if svcRaw, ok := raw.Services[name]; ok {
+			for _, configName := range svcRaw.Configs {
+				ref, found := raw.Configs[configName]
+				if !found {
+					return nil, nil, fmt.Errorf("config %s referenced by service %s is not defined", configName, name)
+				}
+				vol, mount, obj, err := buildFileRefs("config", configName, []string{ref.File}, composeFileDir)
+				if err != nil {
+					return nil, nil, err
+				}
+				kubeVolumes = append(kubeVolumes, vol)
+				mounts = append(mounts, mount)
+				addVolumeObjects(obj)
+			}
+			for _, secretName := range svcRaw.Secrets {
+				ref, found := raw.Secrets[secretName]
+				if !found {
+					return nil, nil, fmt.Errorf("secret %s referenced by service %s is not defined", secretName, name)
+				}
+				vol, mount, obj, err := buildFileRefs("secret", secretName, []string{ref.File}, composeFileDir)
+				if err != nil {
+					return nil, nil, err
+				}
+				kubeVolumes = append(kubeVolumes, vol)
+				mounts = append(mounts, mount)
+				addVolumeObjects(obj)
+			}
+		}
+
+		pod.Volumes = kubeVolumes
+		pod.Containers[0].VolumeMounts = mounts
+
+		// Configure the container restart policy and pick the workload
+		// object to generate it as. "on-failure:N" carries a retry count
+		// that becomes the Job's BackoffLimit.
+		restart, backoffLimit := splitRestart(service.Restart)
+		var objects []interface{}
+		switch {
+		case service.Deploy.Global:
 			pod.RestartPolicy = api.RestartPolicyAlways
-			data, err = yaml.Marshal(replicationController(name, pod))
-		case "no", "false":
-			objType = "pod"
+			objects = append(objects, daemonSet(name, pod))
+		case restart == "" || restart == "always":
+			pod.RestartPolicy = api.RestartPolicyAlways
+			switch controllerType {
+			case "deployment":
+				objects = append(objects, deployment(name, pod, service.Deploy))
+			case "rc":
+				objects = append(objects, replicationController(name, pod, service.Deploy))
+			case "statefulset":
+				objects = append(objects, statefulSet(name, pod, service.Deploy))
+			default:
+				return nil, nil, fmt.Errorf("unknown controller type %s", controllerType)
+			}
+		case restart == "no" || restart == "false":
 			pod.RestartPolicy = api.RestartPolicyNever
-			data, err = yaml.Marshal(job(name, pod))
-		case "on-failure":
-			objType = "job"
+			objects = append(objects, job(name, pod, backoffLimit))
+		case restart == "on-failure":
 			pod.RestartPolicy = api.RestartPolicyOnFailure
-			data, err = yaml.Marshal(job(name, pod))
+			objects = append(objects, job(name, pod, backoffLimit))
 		default:
-			log.Fatalf("Unknown restart policy %s for service %s", service.Restart, name)
+			return nil, nil, fmt.Errorf("unknown restart policy %s for service %s", service.Restart, name)
 		}
 
-		if err != nil {
-			log.Fatalf("Failed to marshal: %v", err)
+		if len(mappedPorts) > 0 || dependedOn[name] {
+			objects = append(objects, service(name, mappedPorts))
 		}
 
-		// Save the job controller for the Docker compose service to the
-		// configs directory.
-		outputFileName := fmt.Sprintf("%s-%s.yaml", name, objType)
-		outputFilePath := filepath.Join(outputDir, outputFileName)
-		if err := ioutil.WriteFile(outputFilePath, data, 0644); err != nil {
-			log.Fatalf("Failed to write job controller %s: %v", outputFileName, err)
-		}
-		fmt.Println(outputFilePath)
+		serviceObjects[name] = objects
+	}
+
+	return serviceObjects, volumeObjects, nil
+}
+
+// volumeObjectKindName returns the lower-case kind fragment and object name
+// of a PersistentVolumeClaim/ConfigMap/Secret produced by buildVolumes or
+// buildFileRefs.
+func volumeObjectKindName(obj interface{}) (kind, name string, err error) {
+	switch o := obj.(type) {
+	case *api.PersistentVolumeClaim:
+		return "pvc", o.Name, nil
+	case *api.ConfigMap:
+		return "configmap", o.Name, nil
+	case *api.Secret:
+		return "secret", o.Name, nil
+	default:
+		return "", "", fmt.Errorf("unsupported object type %T", obj)
+	}
+}
+
+// objectName returns the name a volume object will be dedup'd and written
+// under, e.g. for use as a map key.
+func objectName(obj interface{}) string {
+	_, name, err := volumeObjectKindName(obj)
+	if err != nil {
+		return fmt.Sprintf("%p", obj)
+	}
+	return name
+}
+
+// writeObjectTo marshals a single Kubernetes object and writes it to
+// <dir>/<name>-<kind>.yaml, returning the file name written (relative to
+// dir) for callers that need to reference it, e.g. in a kustomization.yaml.
+func writeObjectTo(dir string, obj interface{}) (string, error) {
+	kind, objName, err := volumeObjectKindName(obj)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal %s %s: %v", kind, objName, err)
+	}
+
+	outputFileName := fmt.Sprintf("%s-%s.yaml", objName, kind)
+	outputFilePath := filepath.Join(dir, outputFileName)
+	if err := ioutil.WriteFile(outputFilePath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", outputFileName, err)
+	}
+	fmt.Println(outputFilePath)
+	return outputFileName, nil
+}
+
+func bytesToStrings(docs [][]byte) []string {
+	strs := make([]string, len(docs))
+	for i, doc := range docs {
+		strs[i] = string(doc)
+	}
+	return strs
+}
+
+// splitRestart splits a compose restart policy such as "on-failure:5" into
+// its base policy and retry count, the latter mapping to a Job's
+// BackoffLimit. Policies with no count return a nil limit.
+func splitRestart(restart string) (string, *int32) {
+	parts := strings.SplitN(restart, ":", 2)
+	if len(parts) != 2 {
+		return restart, nil
 	}
+	count, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return restart, nil
+	}
+	limit := int32(count)
+	return parts[0], &limit
 }
 
-func job(name string, pod *api.PodSpec) *batchv1.Job {
+func job(name string, pod *api.PodSpec, backoffLimit *int32) *batchv1.Job {
 	return &batchv1.Job{
-		TypeMeta: unversioned.TypeMeta{
+		TypeMeta: metav1.TypeMeta{
 			Kind:       "Job",
 			APIVersion: "batch/v1",
 		},
-		ObjectMeta: api.ObjectMeta{
-			Name: strings.ToLower(name),
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   strings.ToLower(name),
+			Labels: map[string]string{"project": projectName},
 		},
 		Spec: batchv1.JobSpec{
+			BackoffLimit: backoffLimit,
 			Template: api.PodTemplateSpec{
-				ObjectMeta: api.ObjectMeta{
-					Labels: map[string]string{"service": name},
-				},
-				Spec: *pod,
-			},
-		},
-	}
-}
-
-func replicationController(name string, pod *api.PodSpec) *api.ReplicationController {
-	var replicas int32 = 1
-	return &api.ReplicationController{
-		TypeMeta: unversioned.TypeMeta{
-			Kind:       "ReplicationController",
-			APIVersion: "v1",
-		},
-		ObjectMeta: api.ObjectMeta{
-			Name: strings.ToLower(name),
-		},
-		Spec: api.ReplicationControllerSpec{
-			Replicas: &replicas,
-			Template: &api.PodTemplateSpec{
-				ObjectMeta: api.ObjectMeta{
+				ObjectMeta: metav1.ObjectMeta{
 					Labels: map[string]string{"service": name},
 				},
 				Spec: *pod,
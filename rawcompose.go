@@ -0,0 +1,57 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+)
+
+// rawComposeFile captures the parts of the compose v3 schema that
+// docker/libcompose's project parser does not understand: top-level
+// configs/secrets and their per-service references. It is parsed
+// independently from the same compose file.
+type rawComposeFile struct {
+	Version  string                       `json:"version"`
+	Services map[string]rawComposeService `json:"services"`
+	Configs  map[string]rawFileRef        `json:"configs"`
+	Secrets  map[string]rawFileRef        `json:"secrets"`
+}
+
+type rawFileRef struct {
+	File string `json:"file"`
+}
+
+type rawComposeService struct {
+	// Short syntax only, e.g. "configs: [my_config]".
+	Configs []string `json:"configs"`
+	Secrets []string `json:"secrets"`
+}
+
+// loadRawComposeFile re-reads the compose file to pick up the configs/
+// secrets sections that the v1/v2-oriented libcompose parser drops.
+// Missing or unparsable sections are treated as empty rather than fatal,
+// since most compose files in the wild won't use them.
+func loadRawComposeFile(path string) rawComposeFile {
+	var raw rawComposeFile
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return raw
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return raw
+	}
+	return raw
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2015 Kelsey Hightower All rights reserved.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultVolumeSize is requested for every PersistentVolumeClaim we
+// generate, since compose has no concept of volume capacity.
+const defaultVolumeSize = "1Gi"
+
+// namedVolume describes either a named volume (backed by a PVC) or a host
+// bind mount (backed by a hostPath volume), parsed from a compose volume
+// entry such as "db-data:/var/lib/mysql" or "./conf:/etc/app:ro".
+type namedVolume struct {
+	Source      string
+	Destination string
+	ReadOnly    bool
+	IsHostPath  bool
+}
+
+// parseVolume parses a compose volume string of the form
+// "source:destination[:ro|rw]". A bare destination with no source is
+// treated as an anonymous volume.
+func parseVolume(v string) namedVolume {
+	parts := strings.Split(v, ":")
+	nv := namedVolume{}
+	switch len(parts) {
+	case 1:
+		nv.Destination = parts[0]
+	case 2:
+		nv.Source, nv.Destination = parts[0], parts[1]
+	default:
+		nv.Source, nv.Destination = parts[0], parts[1]
+		nv.ReadOnly = parts[2] == "ro"
+	}
+	nv.IsHostPath = strings.HasPrefix(nv.Source, "/") || strings.HasPrefix(nv.Source, ".") || strings.HasPrefix(nv.Source, "~")
+	return nv
+}
+
+// volumeName returns the Kubernetes-safe name used for the PersistentVolumeClaim
+// and Volume backing a named (non host-path) compose volume.
+func (nv namedVolume) volumeName() string {
+	return strings.ToLower(strings.NewReplacer("_", "-", ".", "-").Replace(nv.Source))
+}
+
+// persistentVolumeClaim builds a PVC for a named compose volume. Compose has
+// no notion of capacity, so we request a reasonable default size.
+func persistentVolumeClaim(name string) *api.PersistentVolumeClaim {
+	return &api.PersistentVolumeClaim{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"project": projectName},
+		},
+		Spec: api.PersistentVolumeClaimSpec{
+			AccessModes: []api.PersistentVolumeAccessMode{api.ReadWriteOnce},
+			Resources: api.ResourceRequirements{
+				Requests: api.ResourceList{
+					api.ResourceStorage: resource.MustParse(defaultVolumeSize),
+				},
+			},
+		},
+	}
+}
+
+// configMap builds a ConfigMap from a set of file contents, keyed by the
+// file's base name, mirroring how compose `configs`/`secrets` mount files.
+func configMap(name string, files map[string]string) *api.ConfigMap {
+	return &api.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ConfigMap",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"project": projectName},
+		},
+		Data: files,
+	}
+}
+
+// secret builds a Secret from a set of file contents. ghodss/yaml marshals
+// []byte fields as base64 automatically, the same way it marshals Kubernetes
+// Secret.Data today.
+func secret(name string, files map[string][]byte) *api.Secret {
+	return &api.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{"project": projectName},
+		},
+		Type: api.SecretTypeOpaque,
+		Data: files,
+	}
+}
+
+// buildVolumes translates a service's compose volume strings into Kubernetes
+// Volumes/VolumeMounts, returning any PersistentVolumeClaim objects that need
+// to be generated alongside it.
+func buildVolumes(volumes []string) ([]api.Volume, []api.VolumeMount, []interface{}) {
+	var kubeVolumes []api.Volume
+	var mounts []api.VolumeMount
+	var objects []interface{}
+
+	for _, v := range volumes {
+		nv := parseVolume(v)
+		if nv.Destination == "" {
+			continue
+		}
+
+		if nv.IsHostPath {
+			volName := fmt.Sprintf("hostpath-%d", len(kubeVolumes))
+			kubeVolumes = append(kubeVolumes, api.Volume{
+				Name: volName,
+				VolumeSource: api.VolumeSource{
+					HostPath: &api.HostPathVolumeSource{Path: nv.Source},
+				},
+			})
+			mounts = append(mounts, api.VolumeMount{Name: volName, MountPath: nv.Destination, ReadOnly: nv.ReadOnly})
+			continue
+		}
+
+		volName := nv.volumeName()
+		if volName == "" {
+			// Anonymous volume: give it a stable, unique name.
+			volName = fmt.Sprintf("volume-%d", len(kubeVolumes))
+		}
+		kubeVolumes = append(kubeVolumes, api.Volume{
+			Name: volName,
+			VolumeSource: api.VolumeSource{
+				PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{ClaimName: volName, ReadOnly: nv.ReadOnly},
+			},
+		})
+		mounts = append(mounts, api.VolumeMount{Name: volName, MountPath: nv.Destination, ReadOnly: nv.ReadOnly})
+		objects = append(objects, persistentVolumeClaim(volName))
+	}
+
+	return kubeVolumes, mounts, objects
+}
+
+// buildFileRefs turns compose `configs`/`secrets` file references into a
+// ConfigMap or Secret plus the Volume/VolumeMount needed to mount it,
+// reading the referenced file relative to composeFileDir.
+func buildFileRefs(kind string, name string, files []string, composeFileDir string) (api.Volume, api.VolumeMount, interface{}, error) {
+	data := map[string]string{}
+	rawData := map[string][]byte{}
+	for _, f := range files {
+		path := f
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(composeFileDir, path)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return api.Volume{}, api.VolumeMount{}, nil, fmt.Errorf("failed to read %s %s: %v", kind, path, err)
+		}
+		key := filepath.Base(f)
+		data[key] = string(content)
+		rawData[key] = content
+	}
+
+	mountPath := "/" + name
+	switch kind {
+	case "secret":
+		return api.Volume{
+				Name: name,
+				VolumeSource: api.VolumeSource{
+					Secret: &api.SecretVolumeSource{SecretName: name},
+				},
+			},
+			api.VolumeMount{Name: name, MountPath: mountPath, ReadOnly: true},
+			secret(name, rawData),
+			nil
+	default:
+		return api.Volume{
+				Name: name,
+				VolumeSource: api.VolumeSource{
+					ConfigMap: &api.ConfigMapVolumeSource{LocalObjectReference: api.LocalObjectReference{Name: name}},
+				},
+			},
+			api.VolumeMount{Name: name, MountPath: mountPath, ReadOnly: true},
+			configMap(name, data),
+			nil
+	}
+}